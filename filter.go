@@ -0,0 +1,110 @@
+package main
+
+import (
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// generatedFileRE matches the standard "Code generated ... DO NOT EDIT."
+// header recognized by go generate tools.
+var generatedFileRE = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// isGeneratedFile reports whether a line of the first 2048 bytes of
+// content is a standard generated-code header.
+func isGeneratedFile(content []byte) bool {
+	const maxHeaderBytes = 2048 // the convention only requires the header appear near the top
+	if len(content) > maxHeaderBytes {
+		content = content[:maxHeaderBytes]
+	}
+	return generatedFileRE.Match(content)
+}
+
+// globSkipper matches -skip patterns against both a path's base name
+// and its full path, so patterns like "testdata" or "*_gen.go" both
+// work as expected.
+type globSkipper []string
+
+func (g globSkipper) matches(p string) bool {
+	base := filepath.Base(p)
+	for _, pat := range g {
+		if ok, _ := filepath.Match(pat, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pat, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadGitignore reads root/.gitignore, if present, and returns its
+// non-comment, non-blank patterns.
+func loadGitignore(root string) ([]string, error) {
+	b, err := os.ReadFile(filepath.Join(root, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
+// gitignoreMatch reports whether relPath (relative to the walk root) is
+// excluded by any of patterns. This covers the common subset of
+// .gitignore syntax: root-anchored patterns (leading "/"), directory
+// patterns (trailing "/"), and plain globs matched against either the
+// base name or the full relative path; it does not implement "**" or
+// negated patterns.
+func gitignoreMatch(patterns []string, relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	base := path.Base(relPath)
+	for _, pat := range patterns {
+		pat = strings.TrimSuffix(pat, "/")
+		anchored := strings.HasPrefix(pat, "/")
+		pat = strings.TrimPrefix(pat, "/")
+		if anchored {
+			if ok, _ := path.Match(pat, relPath); ok {
+				return true
+			}
+			if strings.HasPrefix(relPath, pat+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pat, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(pat, relPath); ok {
+			return true
+		}
+		if strings.HasPrefix(relPath, pat+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesBuildTags reports whether the file at dir/name would be built
+// under ctx's GOOS/GOARCH with the given comma-separated build tags
+// added, per the rules in go/build (including the "//go:build" /
+// "// +build" constraints and GOOS/GOARCH filename suffixes).
+func matchesBuildTags(dir, name, tags string) (bool, error) {
+	ctx := build.Default
+	if tags != "" {
+		ctx.BuildTags = strings.Split(tags, ",")
+	}
+	return ctx.MatchFile(dir, name)
+}
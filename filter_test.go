@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+func TestIsGeneratedFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{
+			name:    "standard header",
+			content: "// Code generated by foo. DO NOT EDIT.\n\npackage p\n",
+			want:    true,
+		},
+		{
+			name:    "hand written",
+			content: "package p\n\nfunc f() {}\n",
+			want:    false,
+		},
+		{
+			name:    "mentions DO NOT EDIT mid-comment, not at line start",
+			content: "package p\n\n// see the Code generated by foo. DO NOT EDIT. note above\n",
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isGeneratedFile([]byte(tt.content)); got != tt.want {
+				t.Errorf("isGeneratedFile(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobSkipper(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{patterns: []string{"*_gen.go"}, path: "pkg/foo_gen.go", want: true},
+		{patterns: []string{"*_gen.go"}, path: "pkg/foo.go", want: false},
+		{patterns: []string{"testdata"}, path: "testdata", want: true},
+		{patterns: []string{"pkg/foo.go"}, path: "pkg/foo.go", want: true},
+	}
+	for _, tt := range tests {
+		g := globSkipper(tt.patterns)
+		if got := g.matches(tt.path); got != tt.want {
+			t.Errorf("globSkipper(%v).matches(%q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGitignoreMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		relPath  string
+		want     bool
+	}{
+		{patterns: []string{"*.pb.go"}, relPath: "api/v1/thing.pb.go", want: true},
+		{patterns: []string{"*.pb.go"}, relPath: "api/v1/thing.go", want: false},
+		{patterns: []string{"/vendor"}, relPath: "vendor", want: true},
+		{patterns: []string{"/vendor"}, relPath: "pkg/vendor", want: false},
+		{patterns: []string{"build/"}, relPath: "build/out.go", want: true},
+		{patterns: []string{"thing.go"}, relPath: "nested/thing.go", want: true},
+	}
+	for _, tt := range tests {
+		if got := gitignoreMatch(tt.patterns, tt.relPath); got != tt.want {
+			t.Errorf("gitignoreMatch(%v, %q) = %v, want %v", tt.patterns, tt.relPath, got, tt.want)
+		}
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/tools/imports"
@@ -20,18 +27,140 @@ type Replace struct {
 
 type Walker struct {
 	Reps         []Replace
+	Rules        []RewriteRule
 	Modified     []string
 	IncludeFakes bool
-}
 
-// type WalkFunc func(path string, info os.FileInfo, err error) error
+	List             bool     // -l: list files that would change, without writing
+	Diff             bool     // -d: print a unified diff instead of rewriting
+	Write            bool     // -w: write result to the source file (default)
+	AllErrors        bool     // -e: report all parse errors, not just the first 10
+	LocalPrefix      string   // -local: set as imports.LocalPrefix; only used with -goimports
+	Jobs             int      // -j: worker pool size, defaults to GOMAXPROCS
+	UseGoimports     bool     // -goimports: resolve imports with golang.org/x/tools/imports instead of go/format
+	DryRun           bool     // -n/-verify: compute changes in memory, writing nothing
+	Skip             []string // -skip: additional glob patterns to exclude (repeatable)
+	IncludeGenerated bool     // -include-generated: don't skip "Code generated ... DO NOT EDIT." files
+	BuildTags        string   // -build-tags: comma-separated build tags to filter files by
+	UseGitignore     bool     // -gitignore: honor patterns in the walk root's .gitignore
+
+	mu                sync.Mutex
+	diffs             map[string][]byte          // path -> unified diff, populated when Diff is set
+	manifest          []ManifestEntry            // populated when DryRun is set
+	root              string                     // set by Run; used to resolve paths relative to .gitignore
+	gitignorePatterns []string                   // loaded from root/.gitignore when UseGitignore is set
+	packageScopes     map[string]map[string]bool // dir+pkg -> declared package-level names, built by collectPackageScopes
+}
 
-func (w *Walker) skipDir(name string, fi os.FileInfo) error {
-	if name == ".git" || name == "vendor" ||
+// shouldDescend centralizes directory-level pruning -- the fixed
+// .git/vendor/testdata/fake skip list plus -skip globs -- so, together
+// with shouldProcess, every filter (for both directory and file entries)
+// lives in one place instead of being scattered across Run.
+func (w *Walker) shouldDescend(path string, name string) bool {
+	if name == ".git" || name == "vendor" || name == "testdata" ||
 		(!w.IncludeFakes && strings.Contains(name, "fake")) {
-		return filepath.SkipDir
+		return false
 	}
-	return nil
+	if globSkipper(w.Skip).matches(path) {
+		return false
+	}
+	return true
+}
+
+// shouldProcess centralizes every file filter -- extension, -skip globs,
+// .gitignore, generated-code headers, and build tags -- so future
+// filters plug in here instead of being scattered across Run.
+func (w *Walker) shouldProcess(path string, d fs.DirEntry) bool {
+	name := d.Name()
+	if !strings.HasSuffix(name, ".go") {
+		return false
+	}
+	if globSkipper(w.Skip).matches(path) {
+		return false
+	}
+	if w.gitignorePatterns != nil {
+		if rel, err := filepath.Rel(w.root, path); err == nil && gitignoreMatch(w.gitignorePatterns, rel) {
+			return false
+		}
+	}
+	if !w.IncludeGenerated {
+		content, err := ioutil.ReadFile(path)
+		if err == nil && isGeneratedFile(content) {
+			return false
+		}
+	}
+	if w.BuildTags != "" {
+		dir, base := filepath.Split(path)
+		if ok, err := matchesBuildTags(dir, base, w.BuildTags); err == nil && !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// hasBareIdentRules reports whether any -r rule is a bare-identifier
+// rename (as opposed to a selector or import-path rename), the only kind
+// that needs collectPackageScopes: selector and import renames are
+// already fully qualified, so they never need cross-file resolution.
+func (w *Walker) hasBareIdentRules() bool {
+	for _, r := range w.Rules {
+		if !r.ImportPath && r.FromPkg == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// collectPackageScopes parses every file shouldProcess would also rewrite
+// (skipping the same directories shouldDescend prunes from the main
+// walk) just far enough to read its package clause and top-level
+// declared names, and groups them by directory+package. rewriteTyped
+// uses the result to recognize a bare identifier used (unqualified) in
+// one file but declared in another file of the same package --
+// something go/parser's single-file object resolution can't see on its
+// own. Restricting this to files shouldProcess would rewrite matters:
+// a name declared only in a file excluded by -skip/.gitignore/
+// -build-tags/generated-file detection will never actually be renamed
+// there, so treating it as "declared elsewhere" would rename the
+// reference but not the declaration. Parse or read errors are ignored
+// here; handleFile will surface them properly when it processes the
+// file for real.
+func (w *Walker) collectPackageScopes(root string) (map[string]map[string]bool, error) {
+	scopes := make(map[string]map[string]bool)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if !w.shouldDescend(path, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !w.shouldProcess(path, d) {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, src, 0)
+		if err != nil {
+			return nil
+		}
+		key := packageScopeKey(path, file.Name.Name)
+		names := scopes[key]
+		if names == nil {
+			names = make(map[string]bool)
+			scopes[key] = names
+		}
+		for name := range file.Scope.Objects {
+			names[name] = true
+		}
+		return nil
+	})
+	return scopes, err
 }
 
 func (w *Walker) MatchFile(path string) bool {
@@ -51,69 +180,260 @@ func (w *Walker) containsReplacement(b []byte) bool {
 	return false
 }
 
-func (w *Walker) Replace(filename string) error {
-	// this is lazy, but whatever
-	b, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return err
+// rewriteSource applies w.Reps or w.Rules to src in memory, without
+// touching disk, and reports whether anything changed.
+func (w *Walker) rewriteSource(filename string, src []byte) ([]byte, bool, error) {
+	if len(w.Rules) > 0 {
+		return rewriteTyped(filename, src, w.Rules, w.AllErrors, w.packageScopes)
 	}
-	if !w.containsReplacement(b) {
-		return nil
+	if !w.containsReplacement(src) {
+		return src, false, nil
 	}
+	out := src
 	for _, r := range w.Reps {
-		b = bytes.Replace(b, []byte(r.From), []byte(r.To), -1)
-	}
-	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
-		return err
+		out = bytes.Replace(out, []byte(r.From), []byte(r.To), -1)
 	}
-	w.Modified = append(w.Modified, filename)
-	return nil
+	return out, true, nil
 }
 
-func (w *Walker) Walk(path string, fi os.FileInfo, err error) error {
-	name := fi.Name()
-	if fi.IsDir() {
-		return w.skipDir(name, fi)
+// processFile rewrites src and formats the result, returning the final
+// bytes and whether they differ from src. Import-path renames are
+// already folded into the import block by rewriteSource (via
+// astutil.RewriteImport), so by default formatting is just go/format,
+// which is far cheaper than resolving imports. Pass -goimports to fall
+// back to golang.org/x/tools/imports for the rare case of a rewrite that
+// needs imports added or removed outright.
+func (w *Walker) processFile(filename string, src []byte) ([]byte, bool, error) {
+	out, changed, err := w.rewriteSource(filename, src)
+	if err != nil {
+		return nil, false, err
 	}
-	if !strings.HasSuffix(name, ".go") {
-		return nil
+
+	var formatted []byte
+	if w.UseGoimports {
+		imports.LocalPrefix = w.LocalPrefix
+		formatted, err = imports.Process(filename, out, &imports.Options{
+			AllErrors: w.AllErrors,
+			Comments:  true,
+			TabIndent: true,
+			TabWidth:  8,
+		})
+	} else {
+		formatted, err = format.Source(out)
 	}
-	if err := w.Replace(path); err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+	if err != nil {
+		return nil, false, err
 	}
-	return nil
+	return formatted, changed || !bytes.Equal(formatted, src), nil
 }
 
-func (w *Walker) fmtImports(filename string) error {
-	b, err := ioutil.ReadFile(filename)
+// handleFile runs processFile over src and acts on the result according
+// to the -l/-d/-w flags. It is safe to call concurrently: updates to
+// w.Modified and w.diffs are serialized under w.mu.
+func (w *Walker) handleFile(path string, src []byte) error {
+	out, changed, err := w.processFile(path, src)
 	if err != nil {
 		return err
 	}
-	out, err := imports.Process(filename, b, nil)
-	if err != nil {
-		return err
+	if !changed {
+		return nil
+	}
+
+	if w.DryRun {
+		preHash, err := fileHash(src)
+		if err != nil {
+			return err
+		}
+		postHash, err := fileHash(out)
+		if err != nil {
+			return err
+		}
+		w.mu.Lock()
+		w.Modified = append(w.Modified, path)
+		w.manifest = append(w.manifest, ManifestEntry{Path: path, PreHash: preHash, PostHash: postHash})
+		w.mu.Unlock()
+		return nil
+	}
+
+	if w.Write && !w.List && !w.Diff {
+		if err := ioutil.WriteFile(path, out, 0644); err != nil {
+			return err
+		}
 	}
-	return ioutil.WriteFile(filename, out, 0644)
-}
 
-func (w *Walker) FormatImports() error {
-	for _, name := range w.Modified {
-		if err := w.fmtImports(name); err != nil {
+	w.mu.Lock()
+	w.Modified = append(w.Modified, path)
+	if w.Diff {
+		data, err := diffBytes(src, out, path)
+		if err != nil {
+			w.mu.Unlock()
 			return err
 		}
+		w.diffs[path] = data
 	}
+	w.mu.Unlock()
 	return nil
 }
 
+// Run walks root, dispatching every matched .go file to a bounded pool of
+// w.Jobs workers (default runtime.GOMAXPROCS(0)). It uses filepath.WalkDir
+// so directory entries are read via fs.DirEntry, avoiding an os.Lstat per
+// entry.
+func (w *Walker) Run(root string) error {
+	if w.Diff {
+		w.diffs = make(map[string][]byte)
+	}
+	w.root = root
+	if w.UseGitignore {
+		patterns, err := loadGitignore(root)
+		if err != nil {
+			return err
+		}
+		w.gitignorePatterns = patterns
+	}
+	if w.hasBareIdentRules() {
+		scopes, err := w.collectPackageScopes(root)
+		if err != nil {
+			return err
+		}
+		w.packageScopes = scopes
+	}
+
+	jobs := w.Jobs
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	paths := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				src, err := ioutil.ReadFile(path)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+					continue
+				}
+				if err := w.handleFile(path, src); err != nil {
+					if list, ok := err.(scanner.ErrorList); ok {
+						for _, e := range list {
+							fmt.Fprintf(os.Stderr, "%s: %s\n", path, e)
+						}
+						continue
+					}
+					fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				}
+			}
+		}()
+	}
+
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if !w.shouldDescend(path, name) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !w.shouldProcess(path, d) {
+			return nil
+		}
+		paths <- path
+		return nil
+	})
+	close(paths)
+	wg.Wait()
+
+	sort.Strings(w.Modified)
+	return walkErr
+}
+
 var IncludeFakes bool
 
+// rewriteRuleFlag collects repeated `-r` flags into a []RewriteRule.
+type rewriteRuleFlag struct {
+	rules *[]RewriteRule
+}
+
+func (f rewriteRuleFlag) String() string { return "" }
+
+func (f rewriteRuleFlag) Set(s string) error {
+	r, err := ParseRewriteRule(s)
+	if err != nil {
+		return err
+	}
+	*f.rules = append(*f.rules, r)
+	return nil
+}
+
+var RewriteRules []RewriteRule
+
+// stringSliceFlag collects repeated flags, such as -skip, into a
+// []string.
+type stringSliceFlag struct {
+	values *[]string
+}
+
+func (f stringSliceFlag) String() string { return "" }
+
+func (f stringSliceFlag) Set(s string) error {
+	*f.values = append(*f.values, s)
+	return nil
+}
+
+var SkipPatterns []string
+
+var (
+	listFlag      bool
+	diffFlag      bool
+	writeFlag     bool
+	allErrFlag    bool
+	localPrefix   string
+	jobsFlag      int
+	goimportsFlag bool
+	dryRunFlag    bool
+	verifyFlag    string
+
+	includeGeneratedFlag bool
+	buildTagsFlag        string
+	gitignoreFlag        bool
+)
+
 func init() {
 	flag.BoolVar(&IncludeFakes, "fake", false, "Modify fakes")
+	flag.Var(rewriteRuleFlag{&RewriteRules}, "r", "AST-based rewrite rule, e.g. 'pkg.Old -> pkg.New' (may be repeated)")
+	flag.BoolVar(&listFlag, "l", false, "List files that would change, without writing them")
+	flag.BoolVar(&diffFlag, "d", false, "Print a unified diff instead of rewriting files")
+	flag.BoolVar(&writeFlag, "w", true, "Write result to the source file (default); ignored with -l or -d")
+	flag.BoolVar(&allErrFlag, "e", false, "Report all parse errors, not just the first 10 (go/format's parse of the default path still stops after 10)")
+	flag.StringVar(&localPrefix, "local", "", "Put imports beginning with this prefix in a separate group (comma-separated); only takes effect with -goimports")
+	flag.IntVar(&jobsFlag, "j", 0, "Number of files to process concurrently (default GOMAXPROCS)")
+	flag.BoolVar(&goimportsFlag, "goimports", false, "Resolve imports with golang.org/x/tools/imports instead of the faster go/format (slower, but adds/removes imports outright)")
+	flag.BoolVar(&dryRunFlag, "n", false, "Dry run: compute changes in memory and print a reproducible hash manifest instead of writing")
+	flag.BoolVar(&dryRunFlag, "dry-run", false, "Alias for -n")
+	flag.StringVar(&verifyFlag, "verify", "", "Re-run the rewrite and fail if any resulting hash differs from the given manifest file")
+	flag.Var(stringSliceFlag{&SkipPatterns}, "skip", "Glob pattern to exclude, matched against the file's base name and path (may be repeated)")
+	flag.BoolVar(&includeGeneratedFlag, "include-generated", false, "Also process files with a \"Code generated ... DO NOT EDIT.\" header")
+	flag.StringVar(&buildTagsFlag, "build-tags", "", "Comma-separated build tags; files excluded by these constraints for the host GOOS/GOARCH are skipped")
+	flag.BoolVar(&gitignoreFlag, "gitignore", false, "Honor patterns in the walk root's .gitignore")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage %[1]s: PATH FROM:TO...\n\n"+
+		fmt.Fprintf(os.Stderr, "Usage %[1]s: PATH FROM:TO...\n"+
+			"       %[1]s -r 'FROM -> TO' PATH\n"+
+			"       %[1]s -l | -d PATH [FROM:TO...]\n"+
+			"       %[1]s - FROM:TO... < file.go\n\n"+
 			"  Replace all occurances of FROM with TO in Go files.\n"+
-			"  Example %[1]s . foo:bar baz:buzz\n\n", filepath.Base(os.Args[0]))
+			"  Example %[1]s . foo:bar baz:buzz\n\n"+
+			"  With -r, FROM and TO are typed identifiers, selectors, or import\n"+
+			"  paths, rewritten via the AST instead of raw byte replacement.\n"+
+			"  Example %[1]s -r 'pkg.Old -> pkg.New' .\n\n"+
+			"  PATH may be - to read a single file from stdin and write the\n"+
+			"  result to stdout.\n\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -121,16 +441,37 @@ func init() {
 
 func main() {
 	flag.Parse()
-	if flag.NArg() < 2 {
+	minArgs := 2
+	if len(RewriteRules) > 0 || listFlag || diffFlag || dryRunFlag || verifyFlag != "" {
+		minArgs = 1
+	}
+	if flag.NArg() < minArgs {
 		flag.Usage()
 	}
 
 	dirname := flag.Arg(0)
-	if _, err := os.Stat(dirname); err != nil {
-		flag.Usage()
+	if dirname != "-" {
+		if _, err := os.Stat(dirname); err != nil {
+			flag.Usage()
+		}
 	}
 
-	w := Walker{IncludeFakes: IncludeFakes}
+	w := Walker{
+		IncludeFakes:     IncludeFakes,
+		Rules:            RewriteRules,
+		List:             listFlag,
+		Diff:             diffFlag,
+		Write:            writeFlag,
+		AllErrors:        allErrFlag,
+		LocalPrefix:      localPrefix,
+		Jobs:             jobsFlag,
+		UseGoimports:     goimportsFlag,
+		DryRun:           dryRunFlag || verifyFlag != "",
+		Skip:             SkipPatterns,
+		IncludeGenerated: includeGeneratedFlag,
+		BuildTags:        buildTagsFlag,
+		UseGitignore:     gitignoreFlag,
+	}
 	for _, arg := range flag.Args()[1:] {
 		a := strings.Split(arg, ":")
 		if len(a) != 2 {
@@ -140,15 +481,79 @@ func main() {
 		w.Reps = append(w.Reps, Replace{a[0], a[1]})
 	}
 
+	if dirname == "-" {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			Fatal(err)
+		}
+		out, changed, err := w.processFile("<standard input>", src)
+		if err != nil {
+			Fatal(err)
+		}
+		switch {
+		case w.List:
+			if changed {
+				fmt.Println("<standard input>")
+			}
+		case w.Diff:
+			if changed {
+				data, err := diffBytes(src, out, "<standard input>")
+				if err != nil {
+					Fatal(err)
+				}
+				os.Stdout.Write(data)
+			}
+		default:
+			os.Stdout.Write(out)
+		}
+		return
+	}
+
 	start := time.Now()
-	fmt.Println("Making replacements")
-	if err := filepath.Walk(dirname, w.Walk); err != nil {
+	quiet := dryRunFlag || verifyFlag != ""
+	if !quiet {
+		fmt.Println("Making replacements")
+	}
+	if err := w.Run(dirname); err != nil {
 		Fatal(err)
 	}
 
-	fmt.Println("Formatting imports")
-	if err := w.FormatImports(); err != nil {
-		Fatal(err)
+	if verifyFlag != "" {
+		f, err := os.Open(verifyFlag)
+		if err != nil {
+			Fatal(err)
+		}
+		want, err := ReadManifest(f)
+		f.Close()
+		if err != nil {
+			Fatal(err)
+		}
+		if mismatches := VerifyManifest(want, w.manifest); len(mismatches) > 0 {
+			for _, path := range mismatches {
+				fmt.Fprintf(os.Stderr, "mismatch: %s\n", path)
+			}
+			os.Exit(1)
+		}
+		fmt.Println("OK: matches manifest")
+		return
+	}
+
+	if dryRunFlag {
+		if err := WriteManifest(os.Stdout, w.manifest); err != nil {
+			Fatal(err)
+		}
+		return
+	}
+
+	switch {
+	case listFlag:
+		for _, path := range w.Modified {
+			fmt.Println(path)
+		}
+	case diffFlag:
+		for _, path := range w.Modified {
+			os.Stdout.Write(w.diffs[path])
+		}
 	}
 
 	fmt.Printf("Succuss: %s\n", time.Since(start))
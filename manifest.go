@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// ManifestEntry records the pre- and post-rewrite hash of a single file
+// that a dry run determined would change.
+type ManifestEntry struct {
+	Path     string
+	PreHash  string
+	PostHash string
+}
+
+// fileHash computes the H1 content hash, the same algorithm
+// golang.org/x/mod/sumdb/dirhash uses for module zips, applied here to a
+// single file's bytes so a manifest is reproducible and diffable between
+// runs. A fixed name is passed to dirhash.Hash1 (rather than the file's
+// path) so the hash depends only on content -- two byte-identical files
+// hash the same regardless of the absolute or relative path they were
+// read from.
+func fileHash(content []byte) (string, error) {
+	return dirhash.Hash1([]string{"file"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	})
+}
+
+// WriteManifest writes entries to w, one "path preHash postHash" line
+// per entry, sorted by path so the output is stable across runs.
+func WriteManifest(w io.Writer, entries []ManifestEntry) error {
+	sorted := append([]ManifestEntry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	for _, e := range sorted {
+		if _, err := fmt.Fprintf(w, "%s %s %s\n", e.Path, e.PreHash, e.PostHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadManifest parses a manifest previously written by WriteManifest.
+func ReadManifest(r io.Reader) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed manifest line: %q", line)
+		}
+		entries = append(entries, ManifestEntry{Path: fields[0], PreHash: fields[1], PostHash: fields[2]})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// VerifyManifest compares got against want (as produced by a prior dry
+// run) and returns the sorted list of paths whose hashes differ or that
+// are missing/extra, so a reviewer can tell at a glance whether a large
+// mechanical refactor was applied exactly as advertised.
+func VerifyManifest(want, got []ManifestEntry) []string {
+	wantByPath := make(map[string]ManifestEntry, len(want))
+	for _, e := range want {
+		wantByPath[e.Path] = e
+	}
+	gotByPath := make(map[string]ManifestEntry, len(got))
+	for _, e := range got {
+		gotByPath[e.Path] = e
+	}
+
+	var mismatches []string
+	for path, we := range wantByPath {
+		if ge, ok := gotByPath[path]; !ok || ge.PreHash != we.PreHash || ge.PostHash != we.PostHash {
+			mismatches = append(mismatches, path)
+		}
+	}
+	for path := range gotByPath {
+		if _, ok := wantByPath[path]; !ok {
+			mismatches = append(mismatches, path)
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
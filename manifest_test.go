@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestFileHash_PathIndependent checks that byte-identical content hashes
+// the same on every call. fileHash takes no path, so this is what keeps
+// the manifest hash independent of the path a file was read from.
+func TestFileHash_PathIndependent(t *testing.T) {
+	content := []byte("package p\n")
+	got1, err := fileHash(content)
+	if err != nil {
+		t.Fatalf("fileHash: %s", err)
+	}
+	got2, err := fileHash(content)
+	if err != nil {
+		t.Fatalf("fileHash: %s", err)
+	}
+	if got1 != got2 {
+		t.Errorf("fileHash not deterministic: %q != %q", got1, got2)
+	}
+}
+
+func TestFileHash_DiffersOnContent(t *testing.T) {
+	h1, err := fileHash([]byte("package p\n"))
+	if err != nil {
+		t.Fatalf("fileHash: %s", err)
+	}
+	h2, err := fileHash([]byte("package q\n"))
+	if err != nil {
+		t.Fatalf("fileHash: %s", err)
+	}
+	if h1 == h2 {
+		t.Errorf("fileHash: different content produced the same hash %q", h1)
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	entries := []ManifestEntry{
+		{Path: "b.go", PreHash: "h1:bbb", PostHash: "h1:bbb2"},
+		{Path: "a.go", PreHash: "h1:aaa", PostHash: "h1:aaa2"},
+	}
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, entries); err != nil {
+		t.Fatalf("WriteManifest: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if !strings.HasPrefix(lines[0], "a.go ") {
+		t.Errorf("WriteManifest: want sorted by path, got:\n%s", buf.String())
+	}
+
+	got, err := ReadManifest(&buf)
+	if err != nil {
+		t.Fatalf("ReadManifest: %s", err)
+	}
+	if len(got) != 2 || got[0].Path != "a.go" || got[1].Path != "b.go" {
+		t.Errorf("ReadManifest round-trip mismatch: %+v", got)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	want := []ManifestEntry{
+		{Path: "a.go", PreHash: "h1:a", PostHash: "h1:a2"},
+		{Path: "b.go", PreHash: "h1:b", PostHash: "h1:b2"},
+		{Path: "c.go", PreHash: "h1:c", PostHash: "h1:c2"},
+	}
+	got := []ManifestEntry{
+		{Path: "a.go", PreHash: "h1:a", PostHash: "h1:a2"},        // matches
+		{Path: "b.go", PreHash: "h1:b", PostHash: "h1:DIFFERENT"}, // mismatched hash
+		{Path: "d.go", PreHash: "h1:d", PostHash: "h1:d2"},        // extra, not in want
+		// c.go is missing entirely
+	}
+	mismatches := VerifyManifest(want, got)
+	want_ := []string{"b.go", "c.go", "d.go"}
+	if len(mismatches) != len(want_) {
+		t.Fatalf("VerifyManifest = %v, want %v", mismatches, want_)
+	}
+	for i, p := range want_ {
+		if mismatches[i] != p {
+			t.Errorf("VerifyManifest[%d] = %q, want %q", i, mismatches[i], p)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// RewriteRule describes a single `-r` pattern, mirroring the syntax
+// accepted by `gofmt -r`: either a bare identifier rename
+// ("OldType -> NewType") or a package-qualified selector rename
+// ("pkg.OldName -> pkg.NewName"). A pattern whose FROM or TO looks like
+// an import path (contains a "/") is treated as an import rename
+// instead, updating the ImportSpec and every qualified use.
+type RewriteRule struct {
+	FromPkg, FromName string
+	ToPkg, ToName     string
+	ImportPath        bool // rule renames an import path rather than a symbol
+}
+
+// ParseRewriteRule parses "FROM -> TO" into a RewriteRule.
+func ParseRewriteRule(pattern string) (RewriteRule, error) {
+	parts := strings.SplitN(pattern, "->", 2)
+	if len(parts) != 2 {
+		return RewriteRule{}, fmt.Errorf("invalid -r pattern %q: want FROM -> TO", pattern)
+	}
+	from := strings.TrimSpace(parts[0])
+	to := strings.TrimSpace(parts[1])
+	if from == "" || to == "" {
+		return RewriteRule{}, fmt.Errorf("invalid -r pattern %q: want FROM -> TO", pattern)
+	}
+	if strings.Contains(from, "/") || strings.Contains(to, "/") {
+		return RewriteRule{FromPkg: from, ToPkg: to, ImportPath: true}, nil
+	}
+	fromPkg, fromName := splitSelector(from)
+	toPkg, toName := splitSelector(to)
+	if fromPkg != "" && toPkg != "" && fromPkg != toPkg {
+		return RewriteRule{}, fmt.Errorf("invalid -r pattern %q: package in FROM (%s) and TO (%s) must match", pattern, fromPkg, toPkg)
+	}
+	return RewriteRule{FromPkg: fromPkg, FromName: fromName, ToPkg: toPkg, ToName: toName}, nil
+}
+
+func splitSelector(s string) (pkg, name string) {
+	if i := strings.LastIndex(s, "."); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+// localImportName returns the last element of path, which is the
+// identifier Go code uses to refer to the package absent an explicit
+// rename when the package name matches that element.
+func localImportName(path string) string {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	return path
+}
+
+// importPath returns the unquoted import path of an *ast.ImportSpec.
+func importPath(imp *ast.ImportSpec) string {
+	path, _ := strconv.Unquote(imp.Path.Value)
+	return path
+}
+
+// packageScopeKey identifies the package a file belongs to for the
+// purposes of cross-file bare-identifier resolution: its directory plus
+// its package clause, since a directory can (rarely) hold more than one
+// package (e.g. an external "_test" package).
+func packageScopeKey(filename, pkgName string) string {
+	return filepath.Dir(filename) + "\x00" + pkgName
+}
+
+// rewriteTyped applies rules to the Go source src by parsing it, walking
+// the AST, and renaming matching identifiers, selectors, and import
+// paths, then printing the result back with go/printer so that
+// formatting is preserved. It returns the rewritten source and whether
+// anything changed.
+//
+// A bare-identifier rule only renames the identifier declared at package
+// scope under FromName, and uses resolved to that same declaration (via
+// go/parser's object resolution) -- not every identifier in the file
+// that happens to share the name, such as an unrelated struct field or a
+// shadowing local variable. Since go/parser resolves objects one file at
+// a time, a reference to a same-package declaration that lives in a
+// different file resolves to nothing locally; packageScopes (built by
+// Walker.collectPackageScopes over every file in the walked tree that
+// Walker.shouldProcess accepts)
+// supplies the declared-elsewhere names needed to still recognize those
+// as the real symbol, via file.Unresolved, rather than just giving up on
+// (or worse, guessing at) identifiers the current file can't resolve.
+func rewriteTyped(filename string, src []byte, rules []RewriteRule, allErrors bool, packageScopes map[string]map[string]bool) ([]byte, bool, error) {
+	mode := parser.ParseComments
+	if allErrors {
+		mode |= parser.AllErrors
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, mode)
+	if err != nil {
+		return nil, false, err
+	}
+
+	declaredElsewhere := packageScopes[packageScopeKey(filename, file.Name.Name)]
+	unresolved := make(map[*ast.Ident]bool, len(file.Unresolved))
+	for _, id := range file.Unresolved {
+		unresolved[id] = true
+	}
+
+	changed := false
+
+	// Import path renames: use astutil to rewrite the ImportSpec itself,
+	// and remember the old/new local package identifiers so qualified
+	// uses elsewhere in the file can follow.
+	renamed := make(map[string]string) // old local name -> new local name
+	for _, imp := range file.Imports {
+		aliased := imp.Name != nil // explicit alias: its local name doesn't change
+		oldLocal := localImportName(importPath(imp))
+		for _, r := range rules {
+			if !r.ImportPath || importPath(imp) != r.FromPkg {
+				continue
+			}
+			if astutil.RewriteImport(fset, file, r.FromPkg, r.ToPkg) {
+				if !aliased {
+					renamed[oldLocal] = localImportName(r.ToPkg)
+				}
+				changed = true
+			}
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.SelectorExpr:
+			id, ok := node.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if newLocal, ok := renamed[id.Name]; ok {
+				id.Name = newLocal
+			}
+			for _, r := range rules {
+				if r.ImportPath || r.FromPkg == "" || id.Name != r.FromPkg || node.Sel.Name != r.FromName {
+					continue
+				}
+				node.Sel.Name = r.ToName
+				changed = true
+			}
+			return true
+		case *ast.Ident:
+			for _, r := range rules {
+				if r.ImportPath || r.FromPkg != "" || node.Name != r.FromName {
+					continue
+				}
+				if decl := file.Scope.Lookup(r.FromName); decl != nil {
+					// Declared in this file: only rename the declaration
+					// itself and uses resolved to it -- not an unrelated
+					// struct field or a shadowing local that merely
+					// shares the name.
+					if node.Obj != decl {
+						continue
+					}
+				} else if !unresolved[node] || !declaredElsewhere[r.FromName] {
+					// Not declared in this file. The only other
+					// identifiers worth renaming are ones left in
+					// file.Unresolved -- references go/parser couldn't
+					// resolve locally, which is exactly what an
+					// unqualified use of a symbol declared in a
+					// different file of the same package looks like.
+					// Struct fields, selector .Sel names, and composite
+					// literal keys are never added to Unresolved, so
+					// this still excludes them. declaredElsewhere also
+					// requires the name to actually be declared
+					// somewhere in the package, so a typo or a
+					// predeclared identifier (also left Unresolved)
+					// isn't renamed.
+					continue
+				}
+				node.Name = r.ToName
+				changed = true
+			}
+		}
+		return true
+	})
+
+	if !changed {
+		return src, false, nil
+	}
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRewriteRule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    RewriteRule
+		wantErr bool
+	}{
+		{
+			pattern: "OldName -> NewName",
+			want:    RewriteRule{FromName: "OldName", ToName: "NewName"},
+		},
+		{
+			pattern: "pkg.OldName -> pkg.NewName",
+			want:    RewriteRule{FromPkg: "pkg", FromName: "OldName", ToPkg: "pkg", ToName: "NewName"},
+		},
+		{
+			pattern: "github.com/old/pkg -> github.com/new/pkg",
+			want:    RewriteRule{FromPkg: "github.com/old/pkg", ToPkg: "github.com/new/pkg", ImportPath: true},
+		},
+		{pattern: "OldName", wantErr: true},
+		{pattern: " -> NewName", wantErr: true},
+		{pattern: "OldName -> ", wantErr: true},
+		{pattern: "a.OldName -> b.NewName", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := ParseRewriteRule(tt.pattern)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRewriteRule(%q): want error, got %+v", tt.pattern, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRewriteRule(%q): unexpected error: %s", tt.pattern, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRewriteRule(%q) = %+v, want %+v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRewriteTyped_BareIdentScope guards against renaming every
+// identifier that happens to share FromName's spelling: only the
+// package-level declaration (and uses resolved to it) should change, not
+// unrelated struct fields or a shadowing local.
+func TestRewriteTyped_BareIdentScope(t *testing.T) {
+	const src = `package p
+
+type OldName struct{}
+
+func use() *OldName {
+	return &OldName{}
+}
+
+type Foo struct {
+	OldName int
+}
+
+type Bar struct {
+	OldName int
+}
+
+func local() {
+	OldName := 1
+	_ = OldName
+}
+`
+	rules := []RewriteRule{{FromName: "OldName", ToName: "NewName"}}
+	out, changed, err := rewriteTyped("p.go", []byte(src), rules, false, nil)
+	if err != nil {
+		t.Fatalf("rewriteTyped: %s", err)
+	}
+	if !changed {
+		t.Fatal("rewriteTyped: want changed, got false")
+	}
+	got := string(out)
+	if !strings.Contains(got, "type NewName struct{}") {
+		t.Errorf("declaration not renamed:\n%s", got)
+	}
+	if !strings.Contains(got, "func use() *NewName") || !strings.Contains(got, "&NewName{}") {
+		t.Errorf("use of declaration not renamed:\n%s", got)
+	}
+	if strings.Contains(got, "NewName int") {
+		t.Errorf("unrelated struct field was renamed:\n%s", got)
+	}
+	if !strings.Contains(got, "OldName := 1") {
+		t.Errorf("shadowing local was renamed:\n%s", got)
+	}
+}
+
+func TestRewriteTyped_Selector(t *testing.T) {
+	const src = `package p
+
+import "pkg"
+
+func f() {
+	pkg.OldName()
+}
+`
+	rules := []RewriteRule{{FromPkg: "pkg", FromName: "OldName", ToPkg: "pkg", ToName: "NewName"}}
+	out, changed, err := rewriteTyped("p.go", []byte(src), rules, false, nil)
+	if err != nil {
+		t.Fatalf("rewriteTyped: %s", err)
+	}
+	if !changed || !strings.Contains(string(out), "pkg.NewName()") {
+		t.Errorf("selector not renamed, changed=%v:\n%s", changed, out)
+	}
+}
+
+// TestRewriteTyped_AliasedImport guards against silently skipping
+// astutil.RewriteImport for aliased imports: the path must still be
+// rewritten even though the local alias is left untouched.
+func TestRewriteTyped_AliasedImport(t *testing.T) {
+	const src = `package p
+
+import foo "github.com/old/pkg"
+
+func f() {
+	foo.Do()
+}
+`
+	rules := []RewriteRule{{FromPkg: "github.com/old/pkg", ToPkg: "github.com/new/pkg", ImportPath: true}}
+	out, changed, err := rewriteTyped("p.go", []byte(src), rules, false, nil)
+	if err != nil {
+		t.Fatalf("rewriteTyped: %s", err)
+	}
+	got := string(out)
+	if !changed || !strings.Contains(got, `foo "github.com/new/pkg"`) {
+		t.Errorf("aliased import path not rewritten, changed=%v:\n%s", changed, got)
+	}
+	if !strings.Contains(got, "foo.Do()") {
+		t.Errorf("aliased local name should be left untouched:\n%s", got)
+	}
+}
+
+// TestWalkerRun_BareIdentAcrossFiles guards against the flagship -r use
+// case regressing: a symbol declared in one file and referenced
+// (unqualified) from another file of the same package must still be
+// recognized, via Walker.collectPackageScopes, even though go/parser
+// resolves each file's AST on its own.
+func TestWalkerRun_BareIdentAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go": "package p\n\ntype OldName struct{}\n\nfunc New() *OldName {\n\treturn &OldName{}\n}\n",
+		"b.go": "package p\n\nfunc use() *OldName {\n\treturn New()\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := Walker{Rules: []RewriteRule{{FromName: "OldName", ToName: "NewName"}}, Write: true}
+	if err := w.Run(dir); err != nil {
+		t.Fatalf("Run: %s", err)
+	}
+
+	a, err := os.ReadFile(filepath.Join(dir, "a.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(a), "type NewName struct{}") {
+		t.Errorf("a.go: declaration not renamed:\n%s", a)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "b.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "func use() *NewName") {
+		t.Errorf("b.go: cross-file use not renamed:\n%s", b)
+	}
+}